@@ -0,0 +1,51 @@
+package main
+
+import "sync"
+
+// etaSmoothingWindow is the number of recent GPS speed samples averaged to
+// produce the speed used for eta_s predictions.
+const etaSmoothingWindow = 10
+
+// speedSamplesMu guards speedSamples/lastSmoothedSpeed, written by loop()'s
+// goroutine and read by currentSmoothedSpeed from HTTP handler goroutines.
+var (
+	speedSamplesMu    sync.Mutex
+	speedSamples      []float64
+	lastSmoothedSpeed float64
+)
+
+// recordSpeed appends speed to a fixed-size rolling window and returns the
+// smoothed (mean) speed in m/s.
+func recordSpeed(speed float64) float64 {
+	speedSamplesMu.Lock()
+	defer speedSamplesMu.Unlock()
+
+	speedSamples = append(speedSamples, speed)
+	if len(speedSamples) > etaSmoothingWindow {
+		speedSamples = speedSamples[len(speedSamples)-etaSmoothingWindow:]
+	}
+	var sum float64
+	for _, s := range speedSamples {
+		sum += s
+	}
+	lastSmoothedSpeed = sum / float64(len(speedSamples))
+	return lastSmoothedSpeed
+}
+
+// currentSmoothedSpeed returns the most recent value recordSpeed computed,
+// without taking a new sample. Used by read-only consumers (the HTTP API)
+// that need the same smoothed speed loop() is using without perturbing it.
+func currentSmoothedSpeed() float64 {
+	speedSamplesMu.Lock()
+	defer speedSamplesMu.Unlock()
+	return lastSmoothedSpeed
+}
+
+// etaSeconds returns how long, at smoothedSpeed, it will take to cover
+// distanceM. Returns 0 if smoothedSpeed is not moving.
+func etaSeconds(distanceM, smoothedSpeed float64) float64 {
+	if smoothedSpeed <= 0 {
+		return 0
+	}
+	return distanceM / smoothedSpeed
+}
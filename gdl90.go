@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// GDL90 framing: payloads are byte-stuffed, CRC-16-CCITT'd and delimited by
+// 0x7E, per the GDL90 Data Interface Specification.
+const (
+	gdl90FlagByte     = 0x7E
+	gdl90EscapeByte   = 0x7D
+	gdl90EscapeXor    = 0x20
+	gdl90MsgIDOwnship = 10
+	// gdl90MsgIDRoadStatus is in the private-use message ID range (101-255)
+	// the GDL90 spec reserves for manufacturer-specific messages.
+	gdl90MsgIDRoadStatus = 101
+
+	gdl90BroadcastHz = 1
+)
+
+var crc16Table [256]uint16
+
+func init() {
+	for i := 0; i < 256; i++ {
+		crc := uint16(i) << 8
+		for b := 0; b < 8; b++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc16CCITT(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = (crc << 8) ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// frame byte-stuffs msgID+payload, appends its little-endian CRC-16-CCITT,
+// and wraps the result in 0x7E flag bytes.
+func frame(msgID byte, payload []byte) []byte {
+	body := append([]byte{msgID}, payload...)
+	crc := crc16CCITT(body)
+	body = append(body, byte(crc), byte(crc>>8))
+
+	framed := make([]byte, 0, len(body)+2)
+	framed = append(framed, gdl90FlagByte)
+	for _, b := range body {
+		if b == gdl90FlagByte || b == gdl90EscapeByte {
+			framed = append(framed, gdl90EscapeByte, b^gdl90EscapeXor)
+		} else {
+			framed = append(framed, b)
+		}
+	}
+	framed = append(framed, gdl90FlagByte)
+	return framed
+}
+
+// encodeOwnship builds a GDL90 Ownship Report (msg id 10) from the current
+// position. Fields mapd doesn't track (velocity, altitude, callsign, NIC/NACp)
+// are sent as "unavailable" per the spec.
+func encodeOwnship(pos Position) []byte {
+	payload := make([]byte, 27)
+
+	payload[0] = 0x01                            // status=0 (no alert), address type=1 (self-assigned, placeholder)
+	payload[1], payload[2], payload[3] = 0, 0, 0 // participant address, unavailable
+
+	lat := int32(pos.Latitude * (1 << 23) / 180)
+	lon := int32(pos.Longitude * (1 << 23) / 180)
+	putInt24(payload[4:7], lat)
+	putInt24(payload[7:10], lon)
+
+	// altitude: 12 bits, unavailable (0xFFF), misc nibble: airborne + true track
+	payload[10] = 0xFF
+	payload[11] = 0xF0 | 0x09
+
+	payload[12] = 0 // NIC/NACp, unavailable
+
+	// horizontal velocity (12 bits, 0xFFF) + vertical velocity (12 bits, 0x800), unavailable
+	payload[13] = 0xFF
+	payload[14] = 0xF8
+	payload[15] = 0x00
+
+	track := uint8(math.Mod(pos.Bearing, 360) * 256 / 360)
+	payload[16] = track
+
+	payload[17] = 0 // emitter category, unknown
+	// callsign left zeroed (18:26), emergency/priority code nibble left 0
+
+	return frame(gdl90MsgIDOwnship, payload)
+}
+
+func putInt24(dst []byte, v int32) {
+	dst[0] = byte(v >> 16)
+	dst[1] = byte(v >> 8)
+	dst[2] = byte(v)
+}
+
+// encodeRoadStatus builds the private road-status message: road name, speed
+// limit, advisory limit, and next-hazard warning, all as mapd already
+// computes them each loop.
+func encodeRoadStatus(roadName string, speedLimit, advisoryLimit float64, hazard string, distanceM float64) []byte {
+	name := []byte(roadName)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	haz := []byte(hazard)
+	if len(haz) > 16 {
+		haz = haz[:16]
+	}
+
+	payload := make([]byte, 4+8+8+8+len(name)+1+len(haz))
+	i := 0
+	binary.BigEndian.PutUint32(payload[i:], uint32(len(name)))
+	i += 4
+	binary.BigEndian.PutUint64(payload[i:], math.Float64bits(speedLimit))
+	i += 8
+	binary.BigEndian.PutUint64(payload[i:], math.Float64bits(advisoryLimit))
+	i += 8
+	binary.BigEndian.PutUint64(payload[i:], math.Float64bits(distanceM))
+	i += 8
+	copy(payload[i:], name)
+	i += len(name)
+	payload[i] = byte(len(haz))
+	i++
+	copy(payload[i:], haz)
+
+	return frame(gdl90MsgIDRoadStatus, payload)
+}
+
+// GDL90Output broadcasts ownship position and road status to a UDP endpoint
+// (EFB / ADS-B-style consumers) at gdl90BroadcastHz.
+type GDL90Output struct {
+	conn *net.UDPConn
+
+	mu            sync.RWMutex
+	position      Position
+	roadName      string
+	speedLimit    float64
+	advisoryLimit float64
+	hazard        string
+	hazardDist    float64
+}
+
+// NewGDL90Output dials target, which must be a "udp://host:port" URL.
+func NewGDL90Output(target string) (*GDL90Output, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse gdl90 target")
+	}
+	if u.Scheme != "udp" {
+		return nil, errors.Errorf("unsupported gdl90 scheme %q, want udp", u.Scheme)
+	}
+	addr, err := net.ResolveUDPAddr("udp", u.Host)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not resolve gdl90 address")
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not dial gdl90 address")
+	}
+	return &GDL90Output{conn: conn}, nil
+}
+
+// Update refreshes the fields broadcast on the next tick.
+func (g *GDL90Output) Update(pos Position, roadName string, speedLimit, advisoryLimit float64, hazard string, hazardDist float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.position = pos
+	g.roadName = roadName
+	g.speedLimit = speedLimit
+	g.advisoryLimit = advisoryLimit
+	g.hazard = hazard
+	g.hazardDist = hazardDist
+}
+
+// Start broadcasts the current ownship + road status at gdl90BroadcastHz
+// until ctx is cancelled.
+func (g *GDL90Output) Start(ctx context.Context) {
+	ticker := time.NewTicker(time.Second / gdl90BroadcastHz)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			g.conn.Close()
+			return
+		case <-ticker.C:
+			g.mu.RLock()
+			pos, roadName, speedLimit, advisoryLimit, hazard, hazardDist :=
+				g.position, g.roadName, g.speedLimit, g.advisoryLimit, g.hazard, g.hazardDist
+			g.mu.RUnlock()
+
+			if _, err := g.conn.Write(encodeOwnship(pos)); err != nil {
+				log.Warn().Err(err).Msg("gdl90: could not write ownship report")
+			}
+			if _, err := g.conn.Write(encodeRoadStatus(roadName, speedLimit, advisoryLimit, hazard, hazardDist)); err != nil {
+				log.Warn().Err(err).Msg("gdl90: could not write road status message")
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import "math"
+
+const earthRadiusMeters = 6371000.0
+
+// metersPerDegree approximates meters-per-degree-of-latitude, used to build a
+// local planar projection for the short distances within a single way.
+const metersPerDegree = 111320.0
+
+// haversineMeters returns the great-circle distance between two lat/lon
+// points, in meters.
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return earthRadiusMeters * c
+}
+
+// pointToSegmentMeters approximates the distance from (lat, lon) to the
+// segment (latA, lonA)-(latB, lonB) by projecting onto a local planar frame
+// centered on the segment. Accurate enough over the short segments that make
+// up a single way.
+func pointToSegmentMeters(lat, lon, latA, lonA, latB, lonB float64) float64 {
+	midLat := (latA + latB) / 2 * math.Pi / 180
+	toXY := func(la, lo float64) (float64, float64) {
+		return (lo - lonA) * math.Cos(midLat) * metersPerDegree, (la - latA) * metersPerDegree
+	}
+	px, py := toXY(lat, lon)
+	ax, ay := toXY(latA, lonA)
+	bx, by := toXY(latB, lonB)
+
+	dx, dy := bx-ax, by-ay
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return math.Hypot(px-ax, py-ay)
+	}
+	t := ((px-ax)*dx + (py-ay)*dy) / lengthSq
+	if t < 0 {
+		t = 0
+	} else if t > 1 {
+		t = 1
+	}
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+// distanceAlongWay projects pos onto the closest segment of way, then sums
+// the remaining segment length plus every following segment, returning the
+// distance in meters from pos to the end of way.
+func distanceAlongWay(way Way, pos Position) (float64, error) {
+	nodes, err := way.Nodes()
+	if err != nil {
+		return 0, err
+	}
+	n := nodes.Len()
+	if n < 2 {
+		return 0, nil
+	}
+
+	closestIdx := 0
+	closestDist := math.MaxFloat64
+	for i := 0; i < n-1; i++ {
+		a, b := nodes.At(i), nodes.At(i+1)
+		d := pointToSegmentMeters(pos.Latitude, pos.Longitude, a.Lat(), a.Lon(), b.Lat(), b.Lon())
+		if d < closestDist {
+			closestDist = d
+			closestIdx = i
+		}
+	}
+
+	a, next := nodes.At(closestIdx), nodes.At(closestIdx+1)
+	cosMid := math.Cos((a.Lat() + next.Lat()) / 2 * math.Pi / 180)
+	dx, dy := (next.Lon()-a.Lon())*cosMid, next.Lat()-a.Lat()
+	t := 0.0
+	if lengthSq := dx*dx + dy*dy; lengthSq > 0 {
+		t = ((pos.Longitude-a.Lon())*cosMid*dx + (pos.Latitude-a.Lat())*dy) / lengthSq
+		t = math.Max(0, math.Min(1, t))
+	}
+	projLat, projLon := a.Lat()+t*(next.Lat()-a.Lat()), a.Lon()+t*(next.Lon()-a.Lon())
+	remaining := haversineMeters(projLat, projLon, next.Lat(), next.Lon())
+	for i := closestIdx + 1; i < n-1; i++ {
+		a, b := nodes.At(i), nodes.At(i+1)
+		remaining += haversineMeters(a.Lat(), a.Lon(), b.Lat(), b.Lon())
+	}
+	return remaining, nil
+}
+
+// closestDistanceToWay returns the distance in meters from pos to the
+// closest segment of way, or math.MaxFloat64 if way has fewer than 2 nodes.
+func closestDistanceToWay(way Way, pos Position) (float64, error) {
+	nodes, err := way.Nodes()
+	if err != nil {
+		return 0, err
+	}
+	n := nodes.Len()
+	if n < 2 {
+		return math.MaxFloat64, nil
+	}
+
+	closest := math.MaxFloat64
+	for i := 0; i < n-1; i++ {
+		a, b := nodes.At(i), nodes.At(i+1)
+		d := pointToSegmentMeters(pos.Latitude, pos.Longitude, a.Lat(), a.Lon(), b.Lat(), b.Lon())
+		if d < closest {
+			closest = d
+		}
+	}
+	return closest, nil
+}
+
+// wayLengthMeters sums the haversine length of every segment in way.
+func wayLengthMeters(way Way) (float64, error) {
+	nodes, err := way.Nodes()
+	if err != nil {
+		return 0, err
+	}
+	n := nodes.Len()
+	var total float64
+	for i := 0; i < n-1; i++ {
+		a, b := nodes.At(i), nodes.At(i+1)
+		total += haversineMeters(a.Lat(), a.Lon(), b.Lat(), b.Lon())
+	}
+	return total, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"container/list"
+	"math"
+	"sync"
+)
+
+// indexCellDegrees sizes each grid cell of a WayIndex. ~0.01 degrees is
+// roughly 1km at the equator, small enough to keep candidate lists short on
+// dense urban tiles while keeping the cell count manageable.
+const indexCellDegrees = 0.01
+
+type cellKey struct {
+	latCell int
+	lonCell int
+}
+
+// WayIndex is a grid-hashed spatial index over a single Offline tile's ways,
+// built once when the tile is loaded. GetCurrentWay queries CandidatesNear
+// instead of iterating over every way in the tile linearly.
+type WayIndex struct {
+	cells map[cellKey][]Way
+}
+
+// BuildWayIndex buckets every way in offline by the grid cell each of its
+// nodes falls into, so a way can be found from any cell that holds one of its
+// nodes. Cells a segment crosses between two nodes are not indexed.
+func BuildWayIndex(offline Offline) (*WayIndex, error) {
+	ways, err := offline.Ways()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &WayIndex{cells: make(map[cellKey][]Way)}
+	for i := 0; i < ways.Len(); i++ {
+		way := ways.At(i)
+		nodes, err := way.Nodes()
+		if err != nil {
+			continue
+		}
+		seen := make(map[cellKey]bool)
+		for n := 0; n < nodes.Len(); n++ {
+			node := nodes.At(n)
+			key := cellKey{
+				latCell: int(math.Floor(node.Lat() / indexCellDegrees)),
+				lonCell: int(math.Floor(node.Lon() / indexCellDegrees)),
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			idx.cells[key] = append(idx.cells[key], way)
+		}
+	}
+	return idx, nil
+}
+
+// CandidatesNear returns every way with a node in the grid cells covering a
+// radiusMeters circle around (lat, lon). Ways may appear
+// more than once if they cross several matching cells; callers that need a
+// unique set should dedupe on way id.
+func (idx *WayIndex) CandidatesNear(lat, lon, radiusMeters float64) []Way {
+	radiusDegrees := radiusMeters / metersPerDegree
+	cellRadius := int(math.Ceil(radiusDegrees/indexCellDegrees)) + 1
+	centerLatCell := int(math.Floor(lat / indexCellDegrees))
+	centerLonCell := int(math.Floor(lon / indexCellDegrees))
+
+	var candidates []Way
+	for dLat := -cellRadius; dLat <= cellRadius; dLat++ {
+		for dLon := -cellRadius; dLon <= cellRadius; dLon++ {
+			key := cellKey{latCell: centerLatCell + dLat, lonCell: centerLonCell + dLon}
+			candidates = append(candidates, idx.cells[key]...)
+		}
+	}
+	return candidates
+}
+
+// nearestWayRadiusMeters bounds the CandidatesNear search NearestWay runs:
+// wide enough to cover normal GPS drift and lane width, small enough to keep
+// the candidate list short on dense urban tiles.
+const nearestWayRadiusMeters = 50.0
+
+// NearestWay returns the candidate way (from CandidatesNear) whose geometry
+// is closest to pos, used in place of a full linear scan over every way in
+// the tile.
+func (idx *WayIndex) NearestWay(pos Position) (Way, bool) {
+	candidates := idx.CandidatesNear(pos.Latitude, pos.Longitude, nearestWayRadiusMeters)
+
+	var best Way
+	bestDist := math.MaxFloat64
+	found := false
+	for _, way := range candidates {
+		d, err := closestDistanceToWay(way, pos)
+		if err != nil {
+			continue
+		}
+		if d < bestDist {
+			bestDist = d
+			best = way
+			found = true
+		}
+	}
+	return best, found
+}
+
+// getCurrentWayIndexed calls GetCurrentWay, substituting a spatially-indexed
+// nearest-way candidate for the "previous way" hint whenever idx is
+// available, so GetCurrentWay only needs to confirm continuity against a
+// candidate within nearestWayRadiusMeters instead of falling back to
+// iterating the whole tile every time the vehicle has moved off prevWay.
+func getCurrentWayIndexed(idx *WayIndex, prevWay, nextWay, secondNextWay Way, offline Offline, pos Position) (CurrentWay, error) {
+	if idx != nil {
+		if candidate, ok := idx.NearestWay(pos); ok {
+			prevWay = candidate
+		}
+	}
+	return GetCurrentWay(prevWay, nextWay, secondNextWay, offline, pos)
+}
+
+const (
+	defaultCacheSize    = 8
+	defaultCacheTrigger = 1000
+)
+
+// tileCache is the process-wide offline tile cache, sized by main() from the
+// --cache-size and --cache-trigger flags.
+var tileCache = NewTileCache(defaultCacheSize, defaultCacheTrigger)
+
+type tileKey struct {
+	latBucket int
+	lonBucket int
+}
+
+type tileEntry struct {
+	key   tileKey
+	data  []uint8
+	index *WayIndex
+}
+
+// TileCache is an LRU cache of decoded Offline tiles keyed by a (lat, lon)
+// bucket, so repeatedly crossing the same tile boundary doesn't re-trigger
+// FindWaysAroundLocation. Tiles are only cached once they clear
+// minNodeTrigger, mirroring the whosonfirst-pip approach of skipping cache
+// entries too small to be worth the memory.
+type TileCache struct {
+	bucketDegrees  float64
+	capacity       int
+	minNodeTrigger int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[tileKey]*list.Element
+}
+
+// NewTileCache builds a tile cache holding at most capacity tiles, skipping
+// tiles with fewer than minNodeTrigger total nodes.
+func NewTileCache(capacity, minNodeTrigger int) *TileCache {
+	return &TileCache{
+		bucketDegrees:  0.5,
+		capacity:       capacity,
+		minNodeTrigger: minNodeTrigger,
+		order:          list.New(),
+		entries:        make(map[tileKey]*list.Element),
+	}
+}
+
+func (c *TileCache) bucket(lat, lon float64) tileKey {
+	return tileKey{
+		latBucket: int(math.Floor(lat / c.bucketDegrees)),
+		lonBucket: int(math.Floor(lon / c.bucketDegrees)),
+	}
+}
+
+// Get returns the cached tile data and spatial index covering (lat, lon), if any.
+func (c *TileCache) Get(lat, lon float64) ([]uint8, *WayIndex, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := c.bucket(lat, lon)
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	c.order.MoveToFront(elem)
+	entry := elem.Value.(*tileEntry)
+	return entry.data, entry.index, true
+}
+
+// Put caches data (raw, packed Offline bytes) for the tile covering (lat,
+// lon), decoding it once to build the spatial index and check
+// minNodeTrigger. Tiles below the trigger are not cached.
+func (c *TileCache) Put(lat, lon float64, data []uint8) {
+	offline := readOffline(data)
+	ways, err := offline.Ways()
+	if err != nil {
+		return
+	}
+
+	var nodeCount int
+	for i := 0; i < ways.Len(); i++ {
+		if nodes, err := ways.At(i).Nodes(); err == nil {
+			nodeCount += nodes.Len()
+		}
+	}
+	if nodeCount < c.minNodeTrigger {
+		return
+	}
+
+	index, err := BuildWayIndex(offline)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := c.bucket(lat, lon)
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		elem.Value.(*tileEntry).data = data
+		elem.Value.(*tileEntry).index = index
+		return
+	}
+
+	elem := c.order.PushFront(&tileEntry{key: key, data: data, index: index})
+	c.entries[key] = elem
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tileEntry).key)
+	}
+}
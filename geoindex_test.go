@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"capnproto.org/go/capnp/v3"
+)
+
+// buildDenseOfflineTile synthesizes an Offline tile with numWays ways of
+// wayLen nodes each, scattered over a grid of indexCellDegrees-sized cells,
+// to approximate a dense urban tile for the benchmarks below.
+func buildDenseOfflineTile(numWays, wayLen int) (Offline, error) {
+	_, seg, err := capnp.NewMessage(capnp.SingleSegment(nil))
+	if err != nil {
+		return Offline{}, err
+	}
+	offline, err := NewRootOffline(seg)
+	if err != nil {
+		return Offline{}, err
+	}
+
+	ways, err := offline.NewWays(int32(numWays))
+	if err != nil {
+		return Offline{}, err
+	}
+	for i := 0; i < numWays; i++ {
+		way := ways.At(i)
+		nodes, err := way.NewNodes(int32(wayLen))
+		if err != nil {
+			return Offline{}, err
+		}
+		baseLat := 37.0 + float64(i%100)*indexCellDegrees
+		baseLon := -122.0 + float64(i/100)*indexCellDegrees
+		for n := 0; n < wayLen; n++ {
+			node := nodes.At(n)
+			node.SetLat(baseLat + float64(n)*0.0001)
+			node.SetLon(baseLon + float64(n)*0.0001)
+		}
+	}
+	return offline, nil
+}
+
+// linearNearestWay is the pre-index baseline: scan every way in the tile and
+// keep the closest one, the same work GetCurrentWay used to do unindexed.
+func linearNearestWay(offline Offline, pos Position) (Way, bool) {
+	ways, err := offline.Ways()
+	if err != nil {
+		return Way{}, false
+	}
+
+	var best Way
+	bestDist := math.MaxFloat64
+	found := false
+	for i := 0; i < ways.Len(); i++ {
+		way := ways.At(i)
+		d, err := closestDistanceToWay(way, pos)
+		if err != nil {
+			continue
+		}
+		if d < bestDist {
+			bestDist = d
+			best = way
+			found = true
+		}
+	}
+	return best, found
+}
+
+func BenchmarkLinearScanDenseUrbanTile(b *testing.B) {
+	offline, err := buildDenseOfflineTile(2000, 6)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pos := Position{Latitude: 37.5, Longitude: -121.9}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearNearestWay(offline, pos)
+	}
+}
+
+func BenchmarkIndexedScanDenseUrbanTile(b *testing.B) {
+	offline, err := buildDenseOfflineTile(2000, 6)
+	if err != nil {
+		b.Fatal(err)
+	}
+	idx, err := BuildWayIndex(offline)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pos := Position{Latitude: 37.5, Longitude: -121.9}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.NearestWay(pos)
+	}
+}
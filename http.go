@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	loopDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mapd_loop_duration_seconds",
+		Help:    "Duration of each mapd loop() iteration.",
+		Buckets: prometheus.DefBuckets,
+	})
+	panicsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mapd_panics_total",
+		Help: "Number of panics recovered from loop().",
+	})
+	paramReadErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mapd_param_read_errors_total",
+		Help: "Number of failed GetParam calls.",
+	})
+	paramWriteErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mapd_param_write_errors_total",
+		Help: "Number of failed PutParam calls.",
+	})
+	tileCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mapd_tile_cache_hits_total",
+		Help: "Number of offline tile lookups served from the in-memory tile cache.",
+	})
+)
+
+// Server serves the current State as JSON over HTTP and exposes Prometheus metrics.
+// State is read from a snapshot guarded by mu, refreshed once per loop() iteration.
+type Server struct {
+	addr string
+
+	mu    sync.RWMutex
+	state State
+}
+
+func NewServer(addr string) *Server {
+	return &Server{addr: addr}
+}
+
+func (s *Server) updateState(state *State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = *state
+}
+
+func (s *Server) snapshot() State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logwe(errors.Wrap(err, "could not encode http response"))
+	}
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	state := s.snapshot()
+	s.writeJSON(w, struct {
+		RoadName      string   `json:"road_name"`
+		SpeedLimit    float64  `json:"speed_limit"`
+		AdvisoryLimit float64  `json:"advisory_limit"`
+		Position      Position `json:"position"`
+	}{
+		RoadName:      RoadName(state.CurrentWay.Way),
+		SpeedLimit:    state.CurrentWay.Way.MaxSpeed(),
+		AdvisoryLimit: state.CurrentWay.Way.AdvisorySpeed(),
+		Position:      state.Position,
+	})
+}
+
+func (s *Server) handleCurvatures(w http.ResponseWriter, r *http.Request) {
+	state := s.snapshot()
+	curvatures, err := GetStateCurvatures(&state)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, curvatures)
+}
+
+// handleNextSpeed mirrors the next-speed-limit selection loop() does each
+// iteration (see mapd.go's use of selectNextChangeWay), so this endpoint and
+// the legacy params agree on what "next" means instead of handleNextSpeed
+// always reporting state.NextWay regardless of whether its limit changes.
+func (s *Server) handleNextSpeed(w http.ResponseWriter, r *http.Request) {
+	state := s.snapshot()
+
+	distanceToNext, err := distanceAlongWay(state.CurrentWay.Way, state.Position)
+	logde(errors.Wrap(err, "could not compute distance to next way"))
+
+	nextWayLen, err := wayLengthMeters(state.NextWay.Way)
+	logde(errors.Wrap(err, "could not compute next way length"))
+
+	distanceToSecondNext := distanceToNext + nextWayLen
+
+	currentMaxSpeed := state.CurrentWay.Way.MaxSpeed()
+	nextMaxSpeed := state.NextWay.Way.MaxSpeed()
+	secondNextMaxSpeed := state.SecondNextWay.Way.MaxSpeed()
+	nextSpeedWay, nextSpeedDistance := selectNextChangeWay(state.NextWay, state.SecondNextWay, currentMaxSpeed, nextMaxSpeed, secondNextMaxSpeed, distanceToNext, distanceToSecondNext)
+
+	smoothedSpeed := currentSmoothedSpeed()
+	s.writeJSON(w, NextSpeedLimit{
+		Latitude:   nextSpeedWay.StartPosition.Latitude(),
+		Longitude:  nextSpeedWay.StartPosition.Longitude(),
+		Speedlimit: nextSpeedWay.Way.MaxSpeed(),
+		DistanceM:  nextSpeedDistance,
+		EtaS:       etaSeconds(nextSpeedDistance, smoothedSpeed),
+	})
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+// Start runs the HTTP and metrics server until ctx is cancelled, then shuts it down cleanly.
+func (s *Server) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/state", s.handleState)
+	mux.HandleFunc("/curvatures", s.handleCurvatures)
+	mux.HandleFunc("/nextspeed", s.handleNextSpeed)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	httpServer := &http.Server{Addr: s.addr, Handler: mux}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		log.Info().Msg("shutting down http server")
+		return httpServer.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		if err == http.ErrServerClosed {
+			return nil
+		}
+		return err
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"capnproto.org/go/capnp/v3"
+	"github.com/Emalton/mapd/pkg/pub"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -25,12 +29,15 @@ type Position struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 	Bearing   float64 `json:"bearing"`
+	Speed     float64 `json:"speed"`
 }
 
 type NextSpeedLimit struct {
 	Latitude   float64 `json:"latitude"`
 	Longitude  float64 `json:"longitude"`
 	Speedlimit float64 `json:"speedlimit"`
+	DistanceM  float64 `json:"distance_m"`
+	EtaS       float64 `json:"eta_s"`
 }
 
 type AdvisoryLimit struct {
@@ -39,6 +46,8 @@ type AdvisoryLimit struct {
 	EndLatitude    float64 `json:"end_latitude"`
 	EndLongitude   float64 `json:"end_longitude"`
 	Speedlimit     float64 `json:"speedlimit"`
+	DistanceM      float64 `json:"distance_m"`
+	EtaS           float64 `json:"eta_s"`
 }
 
 type Hazard struct {
@@ -47,6 +56,8 @@ type Hazard struct {
 	EndLatitude    float64 `json:"end_latitude"`
 	EndLongitude   float64 `json:"end_longitude"`
 	Hazard         string  `json:"hazard"`
+	DistanceM      float64 `json:"distance_m"`
+	EtaS           float64 `json:"eta_s"`
 }
 
 func RoadName(way Way) string {
@@ -65,6 +76,37 @@ func RoadName(way Way) string {
 	return ""
 }
 
+// getParam wraps GetParam to track param read failures in the mapd_param_read_errors_total metric.
+func getParam(key string) ([]byte, error) {
+	data, err := GetParam(key)
+	if err != nil {
+		paramReadErrors.Inc()
+	}
+	return data, err
+}
+
+// putParam wraps PutParam to track param write failures in the mapd_param_write_errors_total metric.
+func putParam(key string, data []byte) error {
+	err := PutParam(key, data)
+	if err != nil {
+		paramWriteErrors.Inc()
+	}
+	return err
+}
+
+// selectNextChangeWay picks whichever of next/secondNext is the next way
+// where the limit actually changes from currentVal. next is picked when it
+// differs from currentVal or secondVal equals currentVal, unless nextVal is 0
+// (no limit) while secondVal is not; otherwise secondNext is picked. The
+// same rule is used for both speed limits and advisory limits, and by both
+// loop() and the HTTP API's /nextspeed so they agree on "what's next".
+func selectNextChangeWay(next, secondNext NextWayResult, currentVal, nextVal, secondVal, distanceToNext, distanceToSecondNext float64) (NextWayResult, float64) {
+	if (nextVal != currentVal || secondVal == currentVal) && (nextVal != 0 || secondVal == 0) {
+		return next, distanceToNext
+	}
+	return secondNext, distanceToSecondNext
+}
+
 func readOffline(data []uint8) Offline {
 	msg, err := capnp.UnmarshalPacked(data)
 	logde(errors.Wrap(err, "could not unmarshal offline data"))
@@ -83,7 +125,7 @@ func readPosition(persistent bool) (Position, error) {
 	}
 
 	pos := Position{}
-	coordinates, err := GetParam(path)
+	coordinates, err := getParam(path)
 	if err != nil {
 		return pos, errors.Wrap(err, "could not read coordinates param")
 	}
@@ -91,28 +133,25 @@ func readPosition(persistent bool) (Position, error) {
 	return pos, errors.Wrap(err, "could not unmarshal coordinates")
 }
 
-func loop(state *State) {
-	defer func() {
-		if err := recover(); err != nil {
-			e := errors.Errorf("panic occured: %v", err)
-			loge(e)
-			// reset state for next loop
-			state.Data = []uint8{}
-			state.NextWay = NextWayResult{}
-			state.CurrentWay = CurrentWay{}
-			state.Position = Position{}
-			state.SecondNextWay = NextWayResult{}
-		}
-	}()
+// resetState clears state after a panic, so the supervised loop starts its
+// next run from a blank slate instead of whatever was left mid-mutation.
+func resetState(state *State) {
+	state.Data = []uint8{}
+	state.NextWay = NextWayResult{}
+	state.CurrentWay = CurrentWay{}
+	state.Position = Position{}
+	state.SecondNextWay = NextWayResult{}
+}
 
-	logLevelData, err := GetParam(MAPD_LOG_LEVEL)
+func loop(state *State) {
+	logLevelData, err := getParam(MAPD_LOG_LEVEL)
 	if err == nil {
 		level, err := zerolog.ParseLevel(string(logLevelData))
 		if err == nil {
 			zerolog.SetGlobalLevel(level)
 		}
 	}
-	prettyLog, err := GetParam(MAPD_PRETTY_LOG)
+	prettyLog, err := getParam(MAPD_PRETTY_LOG)
 	if err == nil && len(prettyLog) > 0 && prettyLog[0] == '1' {
 		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 		logde(RemoveParam(MAPD_PRETTY_LOG))
@@ -121,7 +160,7 @@ func loop(state *State) {
 		logde(RemoveParam(MAPD_PRETTY_LOG))
 	}
 
-	target_lat_a, err := GetParam(MAP_TARGET_LAT_A)
+	target_lat_a, err := getParam(MAP_TARGET_LAT_A)
 	if err == nil && len(target_lat_a) > 0 {
 		var t_lat_a float64
 		err = json.Unmarshal(target_lat_a, &t_lat_a)
@@ -140,16 +179,28 @@ func loop(state *State) {
 		logwe(errors.Wrap(err, "could not read current position"))
 		return
 	}
+	state.Position = pos
 	offline := readOffline(state.Data)
 
 	// ------------- Find current and next ways ------------
 
+	var wayIndex *WayIndex
 	if !PointInBox(pos.Latitude, pos.Longitude, offline.MinLat(), offline.MinLon(), offline.MaxLat(), offline.MaxLon()) {
-		state.Data, err = FindWaysAroundLocation(pos.Latitude, pos.Longitude)
-		logde(errors.Wrap(err, "could not find ways around current location"))
+		if cached, idx, ok := tileCache.Get(pos.Latitude, pos.Longitude); ok {
+			tileCacheHits.Inc()
+			state.Data = cached
+			wayIndex = idx
+		} else {
+			state.Data, err = FindWaysAroundLocation(pos.Latitude, pos.Longitude)
+			logde(errors.Wrap(err, "could not find ways around current location"))
+			if err == nil {
+				tileCache.Put(pos.Latitude, pos.Longitude, state.Data)
+				_, wayIndex, _ = tileCache.Get(pos.Latitude, pos.Longitude)
+			}
+		}
 	}
 
-	state.CurrentWay, err = GetCurrentWay(state.CurrentWay.Way, state.NextWay.Way, state.SecondNextWay.Way, offline, pos)
+	state.CurrentWay, err = getCurrentWayIndexed(wayIndex, state.CurrentWay.Way, state.NextWay.Way, state.SecondNextWay.Way, offline, pos)
 	logde(errors.Wrap(err, "could not get current way"))
 
 	state.NextWay, err = NextWay(state.CurrentWay.Way, offline, state.CurrentWay.OnWay.IsForward)
@@ -162,31 +213,54 @@ func loop(state *State) {
 	logde(errors.Wrap(err, "could not get curvatures from current state"))
 	target_velocities := GetTargetVelocities(curvatures)
 
+	// -------------- Distance / ETA to upcoming changes --------------
+
+	smoothedSpeed := recordSpeed(pos.Speed)
+
+	distanceToNext, err := distanceAlongWay(state.CurrentWay.Way, pos)
+	logde(errors.Wrap(err, "could not compute distance to next way"))
+
+	nextWayLen, err := wayLengthMeters(state.NextWay.Way)
+	logde(errors.Wrap(err, "could not compute next way length"))
+
+	distanceToSecondNext := distanceToNext + nextWayLen
+
+	// -----------------  Publish state ---------------------
+
+	if statePublisher != nil {
+		snapshot := buildStateSnapshot(state, curvatures, target_velocities)
+		logwe(errors.Wrap(statePublisher.Publish(snapshot), "could not publish state"))
+	}
+
+	if !legacyParams {
+		return
+	}
+
 	// -----------------  Write data ---------------------
 
 	// -----------------  MTSC Data  -----------------------
 	data, err := json.Marshal(curvatures)
 	logde(errors.Wrap(err, "could not marshal curvatures"))
-	err = PutParam(MAP_CURVATURES, data)
+	err = putParam(MAP_CURVATURES, data)
 	logwe(errors.Wrap(err, "could not write curvatures"))
 
 	data, err = json.Marshal(target_velocities)
 	logde(errors.Wrap(err, "could not marshal target velocities"))
-	err = PutParam(MAP_TARGET_VELOCITIES, data)
+	err = putParam(MAP_TARGET_VELOCITIES, data)
 	logwe(errors.Wrap(err, "could not write curvatures"))
 
 	// ----------------- Current Data --------------------
-	err = PutParam(ROAD_NAME, []byte(RoadName(state.CurrentWay.Way)))
+	err = putParam(ROAD_NAME, []byte(RoadName(state.CurrentWay.Way)))
 	logwe(errors.Wrap(err, "could not write road name"))
 
 	data, err = json.Marshal(state.CurrentWay.Way.MaxSpeed())
 	logde(errors.Wrap(err, "could not marshal speed limit"))
-	err = PutParam(MAP_SPEED_LIMIT, data)
+	err = putParam(MAP_SPEED_LIMIT, data)
 	logwe(errors.Wrap(err, "could not write speed limit"))
 
 	data, err = json.Marshal(state.CurrentWay.Way.AdvisorySpeed())
 	logde(errors.Wrap(err, "could not marshal advisory speed limit"))
-	err = PutParam(MAP_ADVISORY_LIMIT, data)
+	err = putParam(MAP_ADVISORY_LIMIT, data)
 	logwe(errors.Wrap(err, "could not write advisory speed limit"))
 
 	hazard, err := state.CurrentWay.Way.Hazard()
@@ -199,7 +273,7 @@ func loop(state *State) {
 		Hazard:         hazard,
 	})
 	logde(errors.Wrap(err, "could not marshal hazard"))
-	err = PutParam(MAP_HAZARD, data)
+	err = putParam(MAP_HAZARD, data)
 	logwe(errors.Wrap(err, "could not write hazard"))
 
 	data, err = json.Marshal(AdvisoryLimit{
@@ -210,7 +284,7 @@ func loop(state *State) {
 		Speedlimit:     state.CurrentWay.Way.AdvisorySpeed(),
 	})
 	logde(errors.Wrap(err, "could not marshal advisory speed limit"))
-	err = PutParam(MAP_ADVISORY_LIMIT, data)
+	err = putParam(MAP_ADVISORY_LIMIT, data)
 	logwe(errors.Wrap(err, "could not write advisory speed limit"))
 
 	// ---------------- Next Data ---------------------
@@ -223,47 +297,43 @@ func loop(state *State) {
 		EndLatitude:    state.NextWay.EndPosition.Latitude(),
 		EndLongitude:   state.NextWay.EndPosition.Longitude(),
 		Hazard:         hazard,
+		DistanceM:      distanceToNext,
+		EtaS:           etaSeconds(distanceToNext, smoothedSpeed),
 	})
 	logde(errors.Wrap(err, "could not marshal next hazard"))
-	err = PutParam(NEXT_MAP_HAZARD, data)
+	err = putParam(NEXT_MAP_HAZARD, data)
 	logwe(errors.Wrap(err, "could not write next hazard"))
 
 	currentMaxSpeed := state.CurrentWay.Way.MaxSpeed()
 	nextMaxSpeed := state.NextWay.Way.MaxSpeed()
 	secondNextMaxSpeed := state.SecondNextWay.Way.MaxSpeed()
-	var nextSpeedWay NextWayResult
-	if (nextMaxSpeed != currentMaxSpeed || secondNextMaxSpeed == currentMaxSpeed) && (nextMaxSpeed != 0 || secondNextMaxSpeed == 0) {
-		nextSpeedWay = state.NextWay
-	} else {
-		nextSpeedWay = state.SecondNextWay
-	}
+	nextSpeedWay, nextSpeedDistance := selectNextChangeWay(state.NextWay, state.SecondNextWay, currentMaxSpeed, nextMaxSpeed, secondNextMaxSpeed, distanceToNext, distanceToSecondNext)
 	data, err = json.Marshal(NextSpeedLimit{
 		Latitude:   nextSpeedWay.StartPosition.Latitude(),
 		Longitude:  nextSpeedWay.StartPosition.Longitude(),
 		Speedlimit: nextSpeedWay.Way.MaxSpeed(),
+		DistanceM:  nextSpeedDistance,
+		EtaS:       etaSeconds(nextSpeedDistance, smoothedSpeed),
 	})
 	logde(errors.Wrap(err, "could not marshal next speed limit"))
-	err = PutParam(NEXT_MAP_SPEED_LIMIT, data)
+	err = putParam(NEXT_MAP_SPEED_LIMIT, data)
 	logwe(errors.Wrap(err, "could not write next speed limit"))
 
 	currentAdvisorySpeed := state.CurrentWay.Way.AdvisorySpeed()
 	nextAdvisorySpeed := state.NextWay.Way.AdvisorySpeed()
 	secondNextAdvisorySpeed := state.SecondNextWay.Way.AdvisorySpeed()
-	var nextAdvisoryWay NextWayResult
-	if (nextAdvisorySpeed != currentAdvisorySpeed || secondNextAdvisorySpeed == currentAdvisorySpeed) && (nextAdvisorySpeed != 0 || secondNextAdvisorySpeed == 0) {
-		nextAdvisoryWay = state.NextWay
-	} else {
-		nextAdvisoryWay = state.SecondNextWay
-	}
+	nextAdvisoryWay, nextAdvisoryDistance := selectNextChangeWay(state.NextWay, state.SecondNextWay, currentAdvisorySpeed, nextAdvisorySpeed, secondNextAdvisorySpeed, distanceToNext, distanceToSecondNext)
 	data, err = json.Marshal(AdvisoryLimit{
 		StartLatitude:  nextAdvisoryWay.StartPosition.Latitude(),
 		StartLongitude: nextAdvisoryWay.StartPosition.Longitude(),
 		EndLatitude:    nextAdvisoryWay.EndPosition.Latitude(),
 		EndLongitude:   nextAdvisoryWay.EndPosition.Longitude(),
 		Speedlimit:     nextAdvisoryWay.Way.AdvisorySpeed(),
+		DistanceM:      nextAdvisoryDistance,
+		EtaS:           etaSeconds(nextAdvisoryDistance, smoothedSpeed),
 	})
 	logde(errors.Wrap(err, "could not marshal next advisory speed limit"))
-	err = PutParam(NEXT_MAP_ADVISORY_LIMIT, data)
+	err = putParam(NEXT_MAP_ADVISORY_LIMIT, data)
 	logwe(errors.Wrap(err, "could not write next advisory speed limit"))
 }
 
@@ -271,7 +341,7 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixNano
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 	l := zerolog.InfoLevel
-	logLevelData, err := GetParam(MAPD_LOG_LEVEL_PERSIST)
+	logLevelData, err := getParam(MAPD_LOG_LEVEL_PERSIST)
 	if err == nil {
 		level, err := zerolog.ParseLevel(string(logLevelData))
 		if err == nil {
@@ -279,7 +349,7 @@ func main() {
 		}
 	}
 	zerolog.SetGlobalLevel(l)
-	prettyLog, err := GetParam(MAPD_PRETTY_LOG_PERSIST)
+	prettyLog, err := getParam(MAPD_PRETTY_LOG_PERSIST)
 	if err == nil && len(prettyLog) > 0 && prettyLog[0] == '1' {
 		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	}
@@ -289,6 +359,15 @@ func main() {
 	minGenLonPtr := flag.Int("minlon", -180, "the minimum longitude to generate")
 	maxGenLatPtr := flag.Int("maxlat", -90, "the maximum latitude to generate")
 	maxGenLonPtr := flag.Int("maxlon", -180, "the maximum longitude to generate")
+	httpAddrPtr := flag.String("http", "", "address for the embedded HTTP/metrics server, e.g. ':8080' (disabled if empty)")
+	legacyParamsPtr := flag.Bool("legacy-params", false, "also write the individual JSON params files, for consumers that haven't moved to the pub socket")
+	pubSocketPtr := flag.String("pub-socket", DEFAULT_PUB_SOCKET, "unix domain socket to broadcast State over")
+	pubMulticastPtr := flag.String("pub-multicast", "", "UDP multicast address to additionally broadcast State to, e.g. '239.0.0.1:9999' (disabled if empty)")
+	cacheSizePtr := flag.Int("cache-size", defaultCacheSize, "number of offline tiles to keep in the LRU tile cache")
+	cacheTriggerPtr := flag.Int("cache-trigger", defaultCacheTrigger, "minimum node count a tile needs before it's worth caching")
+	maxConsecutiveCrashesPtr := flag.Int("max-consecutive-crashes", defaultMaxConsecutive, "exit the process after this many consecutive loop panics, for a supervisor like systemd to restart us")
+	crashCollectorURLPtr := flag.String("crash-collector-url", "", "URL to additionally POST crash reports to (disabled if empty)")
+	gdl90Ptr := flag.String("gdl90", "", "broadcast road name/speed limit/hazard warnings as GDL90 frames to this 'udp://host:port' target (disabled if empty)")
 	flag.Parse()
 	if *generatePtr {
 		GenerateOffline(*minGenLatPtr, *minGenLonPtr, *maxGenLatPtr, *maxGenLonPtr)
@@ -298,6 +377,21 @@ func main() {
 	ResetParams()
 	state := State{}
 
+	tileCache = NewTileCache(*cacheSizePtr, *cacheTriggerPtr)
+
+	legacyParams = *legacyParamsPtr
+	publisher, err := pub.NewPublisher(*pubSocketPtr)
+	if err != nil {
+		loge(errors.Wrap(err, "could not start state publisher, falling back to legacy params"))
+		legacyParams = true
+	} else {
+		statePublisher = publisher
+		defer publisher.Close()
+		if *pubMulticastPtr != "" {
+			logde(errors.Wrap(publisher.ListenMulticast(*pubMulticastPtr), "could not start multicast publisher"))
+		}
+	}
+
 	pos, err := readPosition(true)
 	logde(err)
 	if err == nil {
@@ -305,7 +399,7 @@ func main() {
 		logde(errors.Wrap(err, "could not find ways around initial location"))
 	}
 
-	target_lat_a, err := GetParam(MAP_TARGET_LAT_A_PERSIST)
+	target_lat_a, err := getParam(MAP_TARGET_LAT_A_PERSIST)
 	if err == nil && len(target_lat_a) > 0 {
 		var t_lat_a float64
 		err = json.Unmarshal(target_lat_a, &t_lat_a)
@@ -315,7 +409,53 @@ func main() {
 		}
 	}
 
-	for {
-		loop(&state)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var server *Server
+	if *httpAddrPtr != "" {
+		server = NewServer(*httpAddrPtr)
+		go func() {
+			if err := server.Start(ctx); err != nil {
+				loge(errors.Wrap(err, "http server exited"))
+			}
+		}()
+	}
+
+	var gdl90 *GDL90Output
+	if *gdl90Ptr != "" {
+		gdl90, err = NewGDL90Output(*gdl90Ptr)
+		if err != nil {
+			loge(errors.Wrap(err, "could not start gdl90 output"))
+		} else {
+			go gdl90.Start(ctx)
+		}
 	}
+
+	runForever := func() {
+		for ctx.Err() == nil {
+			start := time.Now()
+			loop(&state)
+			loopDuration.Observe(time.Since(start).Seconds())
+			if server != nil {
+				server.updateState(&state)
+			}
+			if gdl90 != nil {
+				hazard, herr := state.NextWay.Way.Hazard()
+				logde(errors.Wrap(herr, "could not read next hazard for gdl90 output"))
+				distance, derr := distanceAlongWay(state.CurrentWay.Way, state.Position)
+				logde(errors.Wrap(derr, "could not compute next hazard distance for gdl90 output"))
+				gdl90.Update(state.Position, RoadName(state.CurrentWay.Way),
+					state.CurrentWay.Way.MaxSpeed(), state.CurrentWay.Way.AdvisorySpeed(),
+					hazard, distance)
+			}
+		}
+	}
+
+	RunSupervised(ctx, runForever, func() { resetState(&state) },
+		func() Position { return state.Position },
+		func() uint64 { return state.CurrentWay.Way.Id() },
+		*maxConsecutiveCrashesPtr, *crashCollectorURLPtr)
+
+	log.Info().Msg("received shutdown signal, exiting")
 }
@@ -0,0 +1,232 @@
+// Package pub broadcasts a mapd StateMsg (see state.capnp) to any number of
+// subscribers over a Unix domain socket, and optionally over UDP multicast,
+// instead of the loop writing ~10 separate JSON blobs to the params dir.
+package pub
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"capnproto.org/go/capnp/v3"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// WaySummary mirrors the WaySummary struct in state.capnp.
+type WaySummary struct {
+	RoadName       string
+	SpeedLimit     float64
+	AdvisoryLimit  float64
+	Hazard         string
+	StartLatitude  float64
+	StartLongitude float64
+	EndLatitude    float64
+	EndLongitude   float64
+}
+
+// Position mirrors the Position struct in state.capnp.
+type Position struct {
+	Latitude  float64
+	Longitude float64
+	Bearing   float64
+	Speed     float64
+}
+
+// StateSnapshot mirrors the StateMsg schema in state.capnp. Callers build one
+// from their own State once per loop() iteration and hand it to Publish.
+type StateSnapshot struct {
+	CurrentWay       WaySummary
+	NextWay          WaySummary
+	SecondNextWay    WaySummary
+	Position         Position
+	Curvatures       []float64
+	TargetVelocities []float64
+}
+
+// Publisher accepts connections on a Unix domain socket and broadcasts every
+// published StateSnapshot, packed-encoded and length-prefixed, to each of
+// them. It optionally also broadcasts to a UDP multicast group.
+type Publisher struct {
+	socketPath string
+	listener   net.Listener
+
+	multicast *net.UDPConn
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewPublisher starts listening on socketPath, which is removed first if it
+// already exists (a stale socket left behind by a previous, killed process).
+func NewPublisher(socketPath string) (*Publisher, error) {
+	if err := os.RemoveAll(socketPath); err != nil {
+		return nil, errors.Wrap(err, "could not remove stale publisher socket")
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not listen on publisher socket")
+	}
+	p := &Publisher{
+		socketPath: socketPath,
+		listener:   listener,
+		conns:      make(map[net.Conn]struct{}),
+	}
+	go p.acceptLoop()
+	return p, nil
+}
+
+// ListenMulticast additionally broadcasts every published snapshot to the
+// given UDP multicast group address, e.g. "239.0.0.1:9999".
+func (p *Publisher) ListenMulticast(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "could not resolve multicast address")
+	}
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return errors.Wrap(err, "could not dial multicast address")
+	}
+	p.multicast = conn
+	return nil
+}
+
+func (p *Publisher) acceptLoop() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			// listener was closed by Close()
+			return
+		}
+		p.mu.Lock()
+		p.conns[conn] = struct{}{}
+		p.mu.Unlock()
+		log.Debug().Str("remote", conn.RemoteAddr().String()).Msg("pub: subscriber connected")
+	}
+}
+
+// Publish encodes snap as a packed capnp StateMsg and writes it, length
+// prefixed, to every currently-connected subscriber. Subscribers that fail to
+// accept a write are dropped. The first such write error is returned; a
+// failed subscriber never stops delivery to the rest.
+func (p *Publisher) Publish(snap StateSnapshot) error {
+	packed, err := marshal(snap)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal state snapshot")
+	}
+
+	frame := make([]byte, 4+len(packed))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(packed)))
+	copy(frame[4:], packed)
+
+	if p.multicast != nil {
+		if _, err := p.multicast.Write(frame); err != nil {
+			log.Warn().Err(err).Msg("pub: could not write to multicast group")
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var firstErr error
+	for conn := range p.conns {
+		if _, err := conn.Write(frame); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			conn.Close()
+			delete(p.conns, conn)
+		}
+	}
+	return firstErr
+}
+
+// Close shuts down the listener and every open subscriber connection.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+	p.mu.Unlock()
+
+	if p.multicast != nil {
+		p.multicast.Close()
+	}
+	err := p.listener.Close()
+	_ = os.RemoveAll(p.socketPath)
+	return errors.Wrap(err, "could not close publisher listener")
+}
+
+// marshal encodes a StateSnapshot as a packed Cap'n Proto StateMsg message.
+func marshal(snap StateSnapshot) ([]byte, error) {
+	msg, seg, err := capnp.NewMessage(capnp.SingleSegment(nil))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not allocate capnp message")
+	}
+
+	state, err := NewRootStateMsg(seg)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not allocate StateMsg")
+	}
+
+	if err := setWaySummary(state.NewCurrentWay, snap.CurrentWay); err != nil {
+		return nil, err
+	}
+	if err := setWaySummary(state.NewNextWay, snap.NextWay); err != nil {
+		return nil, err
+	}
+	if err := setWaySummary(state.NewSecondNextWay, snap.SecondNextWay); err != nil {
+		return nil, err
+	}
+
+	position, err := state.NewPosition()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not allocate Position")
+	}
+	position.SetLatitude(snap.Position.Latitude)
+	position.SetLongitude(snap.Position.Longitude)
+	position.SetBearing(snap.Position.Bearing)
+	position.SetSpeed(snap.Position.Speed)
+
+	curvatures, err := state.NewCurvatures(int32(len(snap.Curvatures)))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not allocate curvatures list")
+	}
+	for i, c := range snap.Curvatures {
+		curvatures.Set(i, c)
+	}
+
+	targetVelocities, err := state.NewTargetVelocities(int32(len(snap.TargetVelocities)))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not allocate target velocities list")
+	}
+	for i, v := range snap.TargetVelocities {
+		targetVelocities.Set(i, v)
+	}
+
+	return msg.MarshalPacked()
+}
+
+func setWaySummary(newWay func() (WaySummaryMsg, error), summary WaySummary) error {
+	way, err := newWay()
+	if err != nil {
+		return errors.Wrap(err, "could not allocate way summary")
+	}
+	if err := way.SetRoadName(summary.RoadName); err != nil {
+		return errors.Wrap(err, "could not set road name")
+	}
+	way.SetSpeedLimit(summary.SpeedLimit)
+	way.SetAdvisoryLimit(summary.AdvisoryLimit)
+	if err := way.SetHazard(summary.Hazard); err != nil {
+		return errors.Wrap(err, "could not set hazard")
+	}
+	way.SetStartLatitude(summary.StartLatitude)
+	way.SetStartLongitude(summary.StartLongitude)
+	way.SetEndLatitude(summary.EndLatitude)
+	way.SetEndLongitude(summary.EndLongitude)
+	return nil
+}
+
+var _ io.Closer = (*Publisher)(nil)
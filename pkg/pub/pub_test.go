@@ -0,0 +1,80 @@
+package pub
+
+import (
+	"reflect"
+	"testing"
+
+	"capnproto.org/go/capnp/v3"
+)
+
+// TestMarshalRoundTrip builds a StateSnapshot, marshals it, and reads the
+// packed capnp bytes back with the generated StateMsg accessors, to catch
+// schema/binding mismatches like the one that previously broke the build
+// (pub.Position missing the Speed field state.capnp.go expected).
+func TestMarshalRoundTrip(t *testing.T) {
+	snap := StateSnapshot{
+		CurrentWay: WaySummary{
+			RoadName:       "Main St",
+			SpeedLimit:     25,
+			AdvisoryLimit:  20,
+			Hazard:         "pothole",
+			StartLatitude:  1,
+			StartLongitude: 2,
+			EndLatitude:    3,
+			EndLongitude:   4,
+		},
+		NextWay:          WaySummary{RoadName: "2nd Ave"},
+		SecondNextWay:    WaySummary{RoadName: "3rd Ave"},
+		Position:         Position{Latitude: 37.1, Longitude: -122.2, Bearing: 90, Speed: 12.5},
+		Curvatures:       []float64{0.1, 0.2, 0.3},
+		TargetVelocities: []float64{5, 6, 7},
+	}
+
+	packed, err := marshal(snap)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	msg, err := capnp.UnmarshalPacked(packed)
+	if err != nil {
+		t.Fatalf("UnmarshalPacked: %v", err)
+	}
+	state, err := ReadRootStateMsg(msg)
+	if err != nil {
+		t.Fatalf("ReadRootStateMsg: %v", err)
+	}
+
+	currentWay, err := state.CurrentWay()
+	if err != nil {
+		t.Fatalf("CurrentWay: %v", err)
+	}
+	if name, _ := currentWay.RoadName(); name != snap.CurrentWay.RoadName {
+		t.Errorf("RoadName = %q, want %q", name, snap.CurrentWay.RoadName)
+	}
+	if currentWay.SpeedLimit() != snap.CurrentWay.SpeedLimit {
+		t.Errorf("SpeedLimit = %v, want %v", currentWay.SpeedLimit(), snap.CurrentWay.SpeedLimit)
+	}
+	if hazard, _ := currentWay.Hazard(); hazard != snap.CurrentWay.Hazard {
+		t.Errorf("Hazard = %q, want %q", hazard, snap.CurrentWay.Hazard)
+	}
+
+	position, err := state.Position()
+	if err != nil {
+		t.Fatalf("Position: %v", err)
+	}
+	if position.Latitude() != snap.Position.Latitude || position.Speed() != snap.Position.Speed {
+		t.Errorf("Position = %+v, want lat=%v speed=%v", position, snap.Position.Latitude, snap.Position.Speed)
+	}
+
+	curvatures, err := state.Curvatures()
+	if err != nil {
+		t.Fatalf("Curvatures: %v", err)
+	}
+	got := make([]float64, curvatures.Len())
+	for i := range got {
+		got[i] = curvatures.At(i)
+	}
+	if !reflect.DeepEqual(got, snap.Curvatures) {
+		t.Errorf("Curvatures = %v, want %v", got, snap.Curvatures)
+	}
+}
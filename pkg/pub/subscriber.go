@@ -0,0 +1,50 @@
+package pub
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+
+	"capnproto.org/go/capnp/v3"
+	"github.com/pkg/errors"
+)
+
+// Subscriber reads length-prefixed, packed StateMsg frames off a Publisher's
+// Unix domain socket.
+type Subscriber struct {
+	conn net.Conn
+}
+
+// Subscribe dials the publisher listening on socketPath.
+func Subscribe(socketPath string) (*Subscriber, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not dial publisher socket")
+	}
+	return &Subscriber{conn: conn}, nil
+}
+
+// Recv blocks for the next published StateMsg and returns the decoded
+// capnp message. Callers read fields off it with ReadRootStateMsg.
+func (s *Subscriber) Recv() (*capnp.Message, error) {
+	var length uint32
+	if err := binary.Read(s.conn, binary.BigEndian, &length); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "could not read frame length")
+	}
+
+	packed := make([]byte, length)
+	if _, err := io.ReadFull(s.conn, packed); err != nil {
+		return nil, errors.Wrap(err, "could not read frame body")
+	}
+
+	msg, err := capnp.UnmarshalPacked(packed)
+	return msg, errors.Wrap(err, "could not unmarshal state message")
+}
+
+// Close closes the underlying connection.
+func (s *Subscriber) Close() error {
+	return s.conn.Close()
+}
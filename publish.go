@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/Emalton/mapd/pkg/pub"
+	"github.com/pkg/errors"
+)
+
+// DEFAULT_PUB_SOCKET is where the state Publisher listens unless overridden
+// with --pub-socket.
+const DEFAULT_PUB_SOCKET = "/tmp/mapd_state.sock"
+
+// legacyParams keeps the per-field PutParam writes loop() used to do as a
+// fallback for consumers that haven't moved to the pub socket yet.
+var legacyParams bool
+
+// statePublisher broadcasts the full State once per loop() iteration. Left
+// nil if the publisher socket could not be opened.
+var statePublisher *pub.Publisher
+
+// buildStateSnapshot flattens a State into the pub.StateSnapshot broadcast
+// over the publisher socket.
+func buildStateSnapshot(state *State, curvatures, targetVelocities []float64) pub.StateSnapshot {
+	return pub.StateSnapshot{
+		CurrentWay:       waySummary(state.CurrentWay.Way, state.CurrentWay.StartPosition, state.CurrentWay.EndPosition),
+		NextWay:          waySummary(state.NextWay.Way, state.NextWay.StartPosition, state.NextWay.EndPosition),
+		SecondNextWay:    waySummary(state.SecondNextWay.Way, state.SecondNextWay.StartPosition, state.SecondNextWay.EndPosition),
+		Position:         pub.Position(state.Position),
+		Curvatures:       curvatures,
+		TargetVelocities: targetVelocities,
+	}
+}
+
+// waySummary flattens a Way plus its start/end geometry into a pub.WaySummary.
+func waySummary(way Way, start, end interface {
+	Latitude() float64
+	Longitude() float64
+}) pub.WaySummary {
+	hazard, err := way.Hazard()
+	logde(errors.Wrap(err, "could not read way hazard for publish"))
+	return pub.WaySummary{
+		RoadName:       RoadName(way),
+		SpeedLimit:     way.MaxSpeed(),
+		AdvisoryLimit:  way.AdvisorySpeed(),
+		Hazard:         hazard,
+		StartLatitude:  start.Latitude(),
+		StartLongitude: start.Longitude(),
+		EndLatitude:    end.Latitude(),
+		EndLongitude:   end.Longitude(),
+	}
+}
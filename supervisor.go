@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	crashReportDir        = "/tmp/mapd-crashes"
+	initialCrashBackoff   = 1 * time.Second
+	maxCrashBackoff       = 30 * time.Second
+	defaultMaxConsecutive = 5
+	// minHealthyRunDuration is how long fn must run before a subsequent panic
+	// resets consecutive back to 0. Without this, consecutive only resets on
+	// a clean ctx-cancelled return, so occasional panics months apart in an
+	// otherwise-healthy process eventually hit maxConsecutive and exit for
+	// good, which defeats the point of the backoff-and-restart loop.
+	minHealthyRunDuration = 1 * time.Minute
+)
+
+// CrashReport captures everything needed to debug a panic after the fact,
+// written to crashReportDir and optionally POSTed to a collector.
+type CrashReport struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Panic        string    `json:"panic"`
+	Position     Position  `json:"position"`
+	CurrentWayID uint64    `json:"current_way_id"`
+	Goroutines   string    `json:"goroutines"`
+}
+
+// RunSupervised runs fn until ctx is cancelled, recovering any panic that
+// escapes fn into a structured CrashReport, applying exponential backoff
+// before restarting fn, and exiting the process if maxConsecutive crashes
+// happen in a row with no successful restart in between. onCrash is called
+// after the report is built so the caller can reset state before fn restarts.
+// lastPosition and lastWayID are read before that reset, to capture what the
+// loop was looking at when it panicked.
+func RunSupervised(ctx context.Context, fn func(), onCrash func(), lastPosition func() Position, lastWayID func() uint64, maxConsecutive int, collectorURL string) {
+	if maxConsecutive <= 0 {
+		maxConsecutive = defaultMaxConsecutive
+	}
+
+	backoff := initialCrashBackoff
+	consecutive := 0
+
+	for ctx.Err() == nil {
+		// result carries the single outcome of this run: the recovered panic
+		// value, or nil on a clean return. A single channel (rather than a
+		// separate panic channel plus a close(done) signal) guarantees
+		// exactly one send, so the select below can't race between "panic
+		// delivered" and "done closed" and silently pick the wrong case.
+		result := make(chan interface{}, 1)
+		runStart := time.Now()
+
+		go func() {
+			defer func() {
+				result <- recover()
+			}()
+			fn()
+		}()
+
+		select {
+		case <-ctx.Done():
+			<-result
+			return
+		case p := <-result:
+			if p == nil {
+				// fn returned on its own (ctx cancelled mid-loop); nothing to supervise.
+				consecutive = 0
+				backoff = initialCrashBackoff
+				continue
+			}
+
+			consecutive, backoff = resetIfHealthy(consecutive, backoff, time.Since(runStart))
+			consecutive++
+			panicsTotal.Inc()
+			report := buildCrashReport(p, lastPosition(), lastWayID())
+			logCrashReport(report)
+			writeCrashReport(report)
+			if collectorURL != "" {
+				postCrashReport(collectorURL, report)
+			}
+
+			if onCrash != nil {
+				onCrash()
+			}
+
+			if consecutive >= maxConsecutive {
+				log.Fatal().Int("consecutive_crashes", consecutive).Msg("too many consecutive crashes, exiting for the process supervisor to restart us")
+			}
+
+			log.Warn().Dur("backoff", backoff).Msg("restarting after panic")
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxCrashBackoff {
+				backoff = maxCrashBackoff
+			}
+		}
+	}
+}
+
+// resetIfHealthy returns the (consecutive, backoff) to carry into the next
+// crash given that the run which just panicked lasted runDuration: if it ran
+// for at least minHealthyRunDuration, prior crashes are forgiven (reset to
+// the initial state) instead of accumulating toward maxConsecutive forever.
+// Kept separate from RunSupervised's channel/timer plumbing so the
+// reset-on-healthy-run rule can be tested directly.
+func resetIfHealthy(consecutive int, backoff, runDuration time.Duration) (int, time.Duration) {
+	if runDuration >= minHealthyRunDuration {
+		return 0, initialCrashBackoff
+	}
+	return consecutive, backoff
+}
+
+func buildCrashReport(panicValue interface{}, pos Position, wayID uint64) CrashReport {
+	buf := make([]byte, 1<<16)
+	n := runtime.Stack(buf, true)
+	return CrashReport{
+		Timestamp:    time.Now(),
+		Panic:        fmt.Sprintf("%v", panicValue),
+		Position:     pos,
+		CurrentWayID: wayID,
+		Goroutines:   string(buf[:n]),
+	}
+}
+
+func logCrashReport(report CrashReport) {
+	err := errors.Errorf("panic occured: %s", report.Panic)
+	log.Error().
+		Stack().
+		Err(err).
+		Float64("latitude", report.Position.Latitude).
+		Float64("longitude", report.Position.Longitude).
+		Uint64("current_way_id", report.CurrentWayID).
+		Msg("loop panicked")
+}
+
+func writeCrashReport(report CrashReport) {
+	if err := os.MkdirAll(crashReportDir, 0o755); err != nil {
+		log.Warn().Err(err).Msg("could not create crash report directory")
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Warn().Err(err).Msg("could not marshal crash report")
+		return
+	}
+	path := filepath.Join(crashReportDir, fmt.Sprintf("%d.json", report.Timestamp.UnixNano()))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		log.Warn().Err(err).Msg("could not write crash report")
+	}
+}
+
+func postCrashReport(collectorURL string, report CrashReport) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		log.Warn().Err(err).Msg("could not marshal crash report for collector")
+		return
+	}
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(collectorURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Warn().Err(err).Msg("could not post crash report to collector")
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResetIfHealthy(t *testing.T) {
+	tests := []struct {
+		name            string
+		consecutive     int
+		backoff         time.Duration
+		runDuration     time.Duration
+		wantConsecutive int
+		wantBackoff     time.Duration
+	}{
+		{
+			name:            "short run does not reset",
+			consecutive:     3,
+			backoff:         4 * time.Second,
+			runDuration:     minHealthyRunDuration - time.Second,
+			wantConsecutive: 3,
+			wantBackoff:     4 * time.Second,
+		},
+		{
+			name:            "run at exactly the threshold resets",
+			consecutive:     3,
+			backoff:         4 * time.Second,
+			runDuration:     minHealthyRunDuration,
+			wantConsecutive: 0,
+			wantBackoff:     initialCrashBackoff,
+		},
+		{
+			name:            "long healthy run resets",
+			consecutive:     5,
+			backoff:         maxCrashBackoff,
+			runDuration:     10 * minHealthyRunDuration,
+			wantConsecutive: 0,
+			wantBackoff:     initialCrashBackoff,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotConsecutive, gotBackoff := resetIfHealthy(tt.consecutive, tt.backoff, tt.runDuration)
+			if gotConsecutive != tt.wantConsecutive || gotBackoff != tt.wantBackoff {
+				t.Errorf("resetIfHealthy(%d, %v, %v) = (%d, %v), want (%d, %v)",
+					tt.consecutive, tt.backoff, tt.runDuration,
+					gotConsecutive, gotBackoff, tt.wantConsecutive, tt.wantBackoff)
+			}
+		})
+	}
+}
+
+// TestRunSupervisedRestartsAfterPanic exercises the real select/restart loop:
+// fn panics a fixed number of times, then runs cleanly until ctx is
+// cancelled. Verifies every panic is recovered and restarted (rather than
+// silently dropped by the panics/done race this replaced) and that
+// consecutive never reaches maxConsecutive, so the process never
+// log.Fatal()s.
+func TestRunSupervisedRestartsAfterPanic(t *testing.T) {
+	t.Cleanup(func() { os.RemoveAll(crashReportDir) })
+
+	const wantPanics = 3
+	var panicsLeft int32 = wantPanics
+	var crashes int32
+	var runs int32
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fn := func() {
+		atomic.AddInt32(&runs, 1)
+		if atomic.AddInt32(&panicsLeft, -1) >= 0 {
+			panic("boom")
+		}
+		cancel()
+		<-ctx.Done()
+	}
+	onCrash := func() {
+		atomic.AddInt32(&crashes, 1)
+	}
+	lastPosition := func() Position { return Position{} }
+	lastWayID := func() uint64 { return 0 }
+
+	RunSupervised(ctx, fn, onCrash, lastPosition, lastWayID, wantPanics+2, "")
+
+	if got := atomic.LoadInt32(&crashes); got != wantPanics {
+		t.Errorf("crashes = %d, want %d", got, wantPanics)
+	}
+	if got := atomic.LoadInt32(&runs); got != wantPanics+1 {
+		t.Errorf("runs = %d, want %d", got, wantPanics+1)
+	}
+}